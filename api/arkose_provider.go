@@ -0,0 +1,297 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/xqdoo00o/funcaptcha"
+
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+const (
+	harProviderDirName = "harPool"
+	arkoseTokenTTL     = time.Minute * 2
+
+	noProvidersErrorMessage = "no Arkose token providers configured"
+)
+
+// ArkoseProvider obtains a fresh Arkose sentinel token for a chat
+// completion request. GetArkoseToken round-robins across whichever
+// providers are configured, failing over to the next one when a provider
+// errors out.
+type ArkoseProvider interface {
+	Name() string
+	GetToken(apiVersion int, puid string, dx string, proxy string) (string, error)
+}
+
+var arkoseProviders []ArkoseProvider
+var arkoseNext int
+var arkoseMu sync.Mutex
+
+// arkoseTokenCache entries are keyed by (apiVersion, puid, dx): a token
+// solved for one account's puid is rejected by OpenAI for any other
+// account, so the cache can't share a single slot across the token pool.
+var arkoseTokenCache = struct {
+	sync.Mutex
+	byKey map[string]arkoseCacheEntry
+}{byKey: make(map[string]arkoseCacheEntry)}
+
+type arkoseCacheEntry struct {
+	token     string
+	expiresAt time.Time
+}
+
+func arkoseCacheKey(apiVersion int, puid string, dx string) string {
+	return fmt.Sprintf("%d:%s:%s", apiVersion, puid, dx)
+}
+
+func init() {
+	arkoseProviders = append(arkoseProviders, &funcaptchaProvider{})
+
+	if harProvider := newHarReplayProvider(harProviderDirName); harProvider != nil {
+		arkoseProviders = append(arkoseProviders, harProvider)
+	}
+
+	if externalURL := os.Getenv("ARKOSE_PROVIDER_URL"); externalURL != "" {
+		arkoseProviders = append(arkoseProviders, &externalProvider{url: externalURL})
+	}
+}
+
+// funcaptchaProvider is the original, default provider: it solves the
+// Arkose challenge itself via xqdoo00o/funcaptcha.
+type funcaptchaProvider struct{}
+
+func (*funcaptchaProvider) Name() string {
+	return "funcaptcha"
+}
+
+func (*funcaptchaProvider) GetToken(apiVersion int, puid string, dx string, proxy string) (string, error) {
+	return funcaptcha.GetOpenAIToken(apiVersion, puid, dx, proxy)
+}
+
+// harReplayProvider replays Arkose tokens recorded in *.har captures
+// instead of solving the challenge live, for deployments that only have
+// recorded sessions. When Pool (chunk0-1) knows which HAR capture belongs
+// to the requesting puid, GetToken replays from that account's own file
+// instead of the flat pool, since a token solved for one account's session
+// is rejected for another's.
+//
+// This only replays the final token byte-for-byte: it does not extract or
+// mutate the bda/rnd/x-ark-esync-value payloads that produced it. Arkose
+// tokens are short-lived and session-bound, so a replayed token is only
+// good within roughly the window it was originally solved in — real
+// per-request mutation of the captured payloads is out of scope here.
+type harReplayProvider struct {
+	mu           sync.Mutex
+	tokens       []string
+	next         int
+	tokensByFile map[string][]string
+	nextByFile   map[string]int
+}
+
+func newHarReplayProvider(dir string) *harReplayProvider {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.har"))
+	if err != nil || len(matches) == 0 {
+		return nil
+	}
+
+	provider := &harReplayProvider{
+		tokensByFile: make(map[string][]string),
+		nextByFile:   make(map[string]int),
+	}
+	for _, path := range matches {
+		tokens, err := extractArkoseTokens(path)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("failed to extract Arkose tokens from %s", path))
+			continue
+		}
+		provider.tokens = append(provider.tokens, tokens...)
+		provider.tokensByFile[path] = tokens
+	}
+
+	if len(provider.tokens) == 0 {
+		return nil
+	}
+
+	return provider
+}
+
+// extractArkoseTokens scans a HAR capture's entries for the Arkose
+// chat-requirements exchange and pulls out the resulting tokens, ignoring
+// everything else in the capture. It does not extract the bda/rnd/
+// x-ark-esync-value request payloads alongside them, so there is nothing
+// for harReplayProvider to mutate before replaying — see the provider's
+// doc comment.
+func extractArkoseTokens(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var har struct {
+		Log struct {
+			Entries []struct {
+				Request struct {
+					URL string `json:"url"`
+				} `json:"request"`
+				Response struct {
+					Content struct {
+						Text string `json:"text"`
+					} `json:"content"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, err
+	}
+
+	var tokens []string
+	for _, entry := range har.Log.Entries {
+		if !strings.Contains(entry.Request.URL, "/fc/gt2/public_key/") {
+			continue
+		}
+
+		var body struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal([]byte(entry.Response.Content.Text), &body); err != nil {
+			continue
+		}
+		if body.Token != "" {
+			tokens = append(tokens, body.Token)
+		}
+	}
+
+	return tokens, nil
+}
+
+func (*harReplayProvider) Name() string {
+	return "har-replay"
+}
+
+func (provider *harReplayProvider) GetToken(apiVersion int, puid string, dx string, proxy string) (string, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if Pool != nil {
+		if harFile := Pool.HarFileForPUID(puid); harFile != "" {
+			if tokens := provider.tokensByFile[harFile]; len(tokens) > 0 {
+				index := provider.nextByFile[harFile] % len(tokens)
+				provider.nextByFile[harFile]++
+				return tokens[index], nil
+			}
+		}
+	}
+
+	if len(provider.tokens) == 0 {
+		return "", fmt.Errorf("har-replay: no recorded Arkose tokens available")
+	}
+
+	token := provider.tokens[provider.next%len(provider.tokens)]
+	provider.next++
+
+	return token, nil
+}
+
+// externalProvider delegates token generation to a user-hosted HTTP
+// endpoint, for deployments that solve Arkose challenges out-of-process.
+type externalProvider struct {
+	url string
+}
+
+func (*externalProvider) Name() string {
+	return "external"
+}
+
+func (provider *externalProvider) GetToken(apiVersion int, puid string, dx string, proxy string) (string, error) {
+	payload := map[string]interface{}{
+		"api_version": apiVersion,
+		"dx":          dx,
+		"puid":        puid,
+		"proxy":       proxy,
+	}
+	jsonData, _ := json.Marshal(payload)
+
+	req, err := http.NewRequest(http.MethodPost, provider.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client, _ := NewHttpClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("external Arkose provider responded with status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.Token == "" {
+		return "", fmt.Errorf("external Arkose provider returned an empty token")
+	}
+
+	return result.Token, nil
+}
+
+// getArkoseTokenFromProviders round-robins across the configured
+// ArkoseProviders, failing over to the next one on error, and caches a
+// successful token for arkoseTokenTTL so identical back-to-back requests
+// don't re-solve the challenge.
+func getArkoseTokenFromProviders(apiVersion int, puid string, dx string, proxy string) (string, error) {
+	cacheKey := arkoseCacheKey(apiVersion, puid, dx)
+
+	arkoseTokenCache.Lock()
+	if entry, ok := arkoseTokenCache.byKey[cacheKey]; ok && time.Now().Before(entry.expiresAt) {
+		arkoseTokenCache.Unlock()
+		return entry.token, nil
+	}
+	arkoseTokenCache.Unlock()
+
+	arkoseMu.Lock()
+	providers := arkoseProviders
+	start := arkoseNext
+	arkoseNext++
+	arkoseMu.Unlock()
+
+	if len(providers) == 0 {
+		return "", fmt.Errorf(noProvidersErrorMessage)
+	}
+
+	var lastErr error
+	for i := 0; i < len(providers); i++ {
+		provider := providers[(start+i)%len(providers)]
+
+		token, err := provider.GetToken(apiVersion, puid, dx, proxy)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Arkose provider %s failed: %s", provider.Name(), err))
+			lastErr = err
+			continue
+		}
+
+		arkoseTokenCache.Lock()
+		arkoseTokenCache.byKey[cacheKey] = arkoseCacheEntry{token: token, expiresAt: time.Now().Add(arkoseTokenTTL)}
+		arkoseTokenCache.Unlock()
+
+		return token, nil
+	}
+
+	return "", lastErr
+}
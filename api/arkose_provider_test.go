@@ -0,0 +1,158 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type fakeArkoseProvider struct {
+	name  string
+	token string
+	err   error
+	calls int
+}
+
+func (provider *fakeArkoseProvider) Name() string {
+	return provider.name
+}
+
+func (provider *fakeArkoseProvider) GetToken(apiVersion int, puid string, dx string, proxy string) (string, error) {
+	provider.calls++
+	return provider.token, provider.err
+}
+
+func resetArkoseState(t *testing.T, providers []ArkoseProvider) {
+	t.Helper()
+
+	previousProviders := arkoseProviders
+	previousNext := arkoseNext
+	previousCache := arkoseTokenCache.byKey
+
+	arkoseProviders = providers
+	arkoseNext = 0
+	arkoseTokenCache.byKey = make(map[string]arkoseCacheEntry)
+
+	t.Cleanup(func() {
+		arkoseProviders = previousProviders
+		arkoseNext = previousNext
+		arkoseTokenCache.byKey = previousCache
+	})
+}
+
+func TestGetArkoseTokenFromProvidersFailsOverToNextProvider(t *testing.T) {
+	failing := &fakeArkoseProvider{name: "failing", err: fmt.Errorf("solve failed")}
+	working := &fakeArkoseProvider{name: "working", token: "token-1"}
+	resetArkoseState(t, []ArkoseProvider{failing, working})
+
+	token, err := getArkoseTokenFromProviders(4, "puid-a", "dx", "proxy")
+	if err != nil {
+		t.Fatalf("getArkoseTokenFromProviders returned an error: %v", err)
+	}
+	if token != "token-1" {
+		t.Fatalf("token = %q, want token-1", token)
+	}
+	if failing.calls != 1 || working.calls != 1 {
+		t.Fatalf("calls = (failing=%d, working=%d), want both providers tried once", failing.calls, working.calls)
+	}
+}
+
+func TestGetArkoseTokenFromProvidersCachesPerPuid(t *testing.T) {
+	provider := &fakeArkoseProvider{name: "only", token: "token-1"}
+	resetArkoseState(t, []ArkoseProvider{provider})
+
+	if _, err := getArkoseTokenFromProviders(4, "puid-a", "dx", "proxy"); err != nil {
+		t.Fatalf("first call returned an error: %v", err)
+	}
+	if _, err := getArkoseTokenFromProviders(4, "puid-a", "dx", "proxy"); err != nil {
+		t.Fatalf("second call returned an error: %v", err)
+	}
+	if provider.calls != 1 {
+		t.Fatalf("provider called %d times, want 1 (second call should hit the cache)", provider.calls)
+	}
+
+	// A different puid must not reuse puid-a's cached token.
+	if _, err := getArkoseTokenFromProviders(4, "puid-b", "dx", "proxy"); err != nil {
+		t.Fatalf("call for a different puid returned an error: %v", err)
+	}
+	if provider.calls != 2 {
+		t.Fatalf("provider called %d times, want 2 (different puid must not share the cache)", provider.calls)
+	}
+}
+
+func TestGetArkoseTokenFromProvidersReturnsErrorWhenAllFail(t *testing.T) {
+	provider := &fakeArkoseProvider{name: "only", err: fmt.Errorf("solve failed")}
+	resetArkoseState(t, []ArkoseProvider{provider})
+
+	if _, err := getArkoseTokenFromProviders(4, "puid-a", "dx", "proxy"); err == nil {
+		t.Fatal("expected an error when every provider fails")
+	}
+}
+
+func TestGetArkoseTokenFromProvidersNoProvidersConfigured(t *testing.T) {
+	resetArkoseState(t, nil)
+
+	if _, err := getArkoseTokenFromProviders(4, "puid-a", "dx", "proxy"); err == nil {
+		t.Fatal("expected an error when no providers are configured")
+	}
+}
+
+func TestArkoseCacheKeyDistinguishesPuid(t *testing.T) {
+	if arkoseCacheKey(4, "puid-a", "dx") == arkoseCacheKey(4, "puid-b", "dx") {
+		t.Fatal("arkoseCacheKey collided across different puids")
+	}
+}
+
+func TestHarReplayProviderGetTokenRoundRobinsFlatPool(t *testing.T) {
+	provider := &harReplayProvider{
+		tokens:       []string{"token-1", "token-2"},
+		tokensByFile: make(map[string][]string),
+		nextByFile:   make(map[string]int),
+	}
+
+	first, err := provider.GetToken(4, "", "dx", "proxy")
+	if err != nil {
+		t.Fatalf("GetToken returned an error: %v", err)
+	}
+	second, err := provider.GetToken(4, "", "dx", "proxy")
+	if err != nil {
+		t.Fatalf("GetToken returned an error: %v", err)
+	}
+
+	if first == second {
+		t.Fatalf("GetToken returned %q twice in a row, want round-robin across the two recorded tokens", first)
+	}
+}
+
+func TestHarReplayProviderGetTokenErrorsWhenEmpty(t *testing.T) {
+	provider := &harReplayProvider{
+		tokensByFile: make(map[string][]string),
+		nextByFile:   make(map[string]int),
+	}
+
+	if _, err := provider.GetToken(4, "", "dx", "proxy"); err == nil {
+		t.Fatal("expected an error when no tokens have been recorded")
+	}
+}
+
+func TestArkoseCacheEntryExpiresAtIsRespected(t *testing.T) {
+	provider := &fakeArkoseProvider{name: "only", token: "token-1"}
+	resetArkoseState(t, []ArkoseProvider{provider})
+
+	if _, err := getArkoseTokenFromProviders(4, "puid-a", "dx", "proxy"); err != nil {
+		t.Fatalf("first call returned an error: %v", err)
+	}
+
+	arkoseTokenCache.Lock()
+	entry := arkoseTokenCache.byKey[arkoseCacheKey(4, "puid-a", "dx")]
+	entry.expiresAt = time.Now().Add(-time.Second)
+	arkoseTokenCache.byKey[arkoseCacheKey(4, "puid-a", "dx")] = entry
+	arkoseTokenCache.Unlock()
+
+	if _, err := getArkoseTokenFromProviders(4, "puid-a", "dx", "proxy"); err != nil {
+		t.Fatalf("second call returned an error: %v", err)
+	}
+	if provider.calls != 2 {
+		t.Fatalf("provider called %d times, want 2 (expired cache entry must be re-solved)", provider.calls)
+	}
+}
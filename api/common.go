@@ -15,8 +15,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/xqdoo00o/OpenAIAuth/auth"
-	"github.com/xqdoo00o/funcaptcha"
 
+	iosauth "github.com/linweiyuan/go-chatgpt-api/auth"
 	"github.com/linweiyuan/go-logger/logger"
 )
 
@@ -45,6 +45,7 @@ const (
 	defaultTimeoutSeconds              = 600
 
 	EmailKey                       = "email"
+	PuidKey                        = "puid"
 	AccountDeactivatedErrorMessage = "account %s is deactivated"
 
 	ReadyHint = "service go-chatgpt-api is ready"
@@ -57,7 +58,6 @@ const (
 )
 
 var (
-	Client       tls_client.HttpClient
 	ArkoseClient tls_client.HttpClient
 	PUID         string
 	OAIDID       string
@@ -66,6 +66,15 @@ var (
 	ClientProfile profiles.ClientProfile
 	UserAgent    string
 	StartTime = time.Now()
+
+	// Pool is the multi-account token pool, populated from accounts.txt /
+	// harPool/ when present. It stays nil for the single-account setup, in
+	// which case Proxy and GetAccessToken fall back to the globals above.
+	Pool *TokenPool
+
+	// Files caches successful /backend-api/files uploads so Proxy can
+	// short-circuit a re-upload of bytes it's already seen from an account.
+	Files *FileCache
 )
 
 type LoginInfo struct {
@@ -100,25 +109,47 @@ func init() {
 	if UserAgent == "" {
 		UserAgent = DefaultUserAgent
 	}
-	Client, _ = tls_client.NewHttpClient(tls_client.NewNoopLogger(), []tls_client.HttpClientOption{
-		tls_client.WithCookieJar(tls_client.NewCookieJar()),
-		tls_client.WithTimeoutSeconds(defaultTimeoutSeconds),
-		tls_client.WithClientProfile(ClientProfile),
-	}...)
 	ArkoseClient = getHttpClient()
 
-	setupIDs()
+	ProxyUrl = os.Getenv("PROXY")
+	Rotator = NewProxyRotator()
+	Files = NewFileCache(fileCacheDirName, defaultFileCacheByteBudget)
+
+	Pool = NewTokenPool()
+	if Pool == nil {
+		setupIDs()
+	}
 }
 
-func NewHttpClient() tls_client.HttpClient {
-	client := getHttpClient()
+// currentProxy returns the proxy to use for the next outgoing request: the
+// next healthy entry from proxies.txt if Rotator is active, otherwise the
+// single PROXY env var every request has always used.
+func currentProxy() string {
+	if Rotator != nil {
+		return Rotator.Next()
+	}
 
-	ProxyUrl = os.Getenv("PROXY")
-	if ProxyUrl != "" {
-		client.SetProxy(ProxyUrl)
+	return ProxyUrl
+}
+
+// NewHttpClient builds a client dedicated to a single request and points it
+// at the next proxy from currentProxy(), returning that proxy alongside it
+// so the caller can report its health back to Rotator. Building a fresh
+// client per call (rather than sharing one) avoids one request's SetProxy
+// clobbering another's mid-flight under gin's concurrent handlers.
+func NewHttpClient() (tls_client.HttpClient, string) {
+	client, _ := tls_client.NewHttpClient(tls_client.NewNoopLogger(), []tls_client.HttpClientOption{
+		tls_client.WithCookieJar(tls_client.NewCookieJar()),
+		tls_client.WithTimeoutSeconds(defaultTimeoutSeconds),
+		tls_client.WithClientProfile(ClientProfile),
+	}...)
+
+	proxyUrl := currentProxy()
+	if proxyUrl != "" {
+		client.SetProxy(proxyUrl)
 	}
 
-	return client
+	return client, proxyUrl
 }
 
 func getHttpClient() tls_client.HttpClient {
@@ -148,28 +179,82 @@ func Proxy(c *gin.Context) {
 	// if not set, will return 404
 	c.Status(http.StatusOK)
 
+	var body []byte
+	if method != http.MethodGet {
+		body, _ = io.ReadAll(c.Request.Body)
+	}
+
+	account := c.GetString(EmailKey)
+	isFileUpload := Files != nil && method == http.MethodPost && strings.HasSuffix(c.Request.URL.Path, "/files")
+	var fileCacheKey string
+	if isFileUpload {
+		fileCacheKey = Key(account, body)
+		if cached := Files.Lookup(account, fileCacheKey); cached != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"file_id":   cached.Fileid,
+				"mime_type": cached.Mime,
+			})
+			return
+		}
+	}
+
 	var req *http.Request
 	if method == http.MethodGet {
 		req, _ = http.NewRequest(http.MethodGet, url, nil)
 	} else {
-		body, _ := io.ReadAll(c.Request.Body)
 		req, _ = http.NewRequest(method, url, bytes.NewReader(body))
 	}
+	oaidid := OAIDID
+	accessToken := GetAccessToken(c)
+	if Pool != nil {
+		var poolAccessToken, poolPuid string
+		poolAccessToken, poolPuid, oaidid = Pool.Acquire(c)
+		if poolAccessToken != "" {
+			accessToken = "Bearer " + poolAccessToken
+		}
+		if poolPuid != "" {
+			// Downstream handlers that solve an Arkose token for this request
+			// (GetArkoseToken) must use this account's own puid, not the
+			// single-account PUID global, since a token solved for one
+			// account's puid is rejected by OpenAI for any other account.
+			c.Set(PuidKey, poolPuid)
+		}
+	}
+
 	req.Header.Set("User-Agent", UserAgent)
-	req.Header.Set(AuthorizationHeader, GetAccessToken(c))
+	req.Header.Set(AuthorizationHeader, accessToken)
 	req.Header.Set("Oai-Language", Language)
-	req.Header.Set("Oai-Device-Id", OAIDID)
-	req.Header.Set("Cookie", req.Header.Get("Cookie")+"oai-did="+OAIDID+";")
-	resp, err := Client.Do(req)
+	req.Header.Set("Oai-Device-Id", oaidid)
+	req.Header.Set("Cookie", req.Header.Get("Cookie")+"oai-did="+oaidid+";")
+
+	// Each request gets its own client (rather than a shared package-level
+	// one) so one goroutine's proxy selection can't leak into another's
+	// in-flight request under gin's concurrent handlers.
+	client, proxyUrl := NewHttpClient()
+	resp, err := client.Do(req)
 	if err != nil {
+		if proxyUrl != "" && Rotator != nil {
+			Rotator.MarkFailure(proxyUrl, 0)
+		}
 		c.AbortWithStatusJSON(http.StatusInternalServerError, ReturnMessage(err.Error()))
 		return
 	}
 
 	defer resp.Body.Close()
+	if proxyUrl != "" && Rotator != nil {
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusProxyAuthRequired {
+			Rotator.MarkFailure(proxyUrl, resp.StatusCode)
+		} else {
+			Rotator.MarkSuccess(proxyUrl)
+		}
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusUnauthorized {
 			logger.Error(fmt.Sprintf(AccountDeactivatedErrorMessage, c.GetString(EmailKey)))
+			if Pool != nil {
+				Pool.Deactivate(strings.TrimPrefix(accessToken, "Bearer "))
+			}
 		}
 
 		responseMap := make(map[string]interface{})
@@ -178,9 +263,55 @@ func Proxy(c *gin.Context) {
 		return
 	}
 
+	if isFileUpload {
+		respBody, _ := io.ReadAll(resp.Body)
+		storeUploadedFile(fileCacheKey, body, respBody)
+		c.Writer.Write(respBody)
+		return
+	}
+
 	io.Copy(c.Writer, resp.Body)
 }
 
+// storeUploadedFile caches a successful /backend-api/files upload response
+// so an identical (account, name, size, mime) request short-circuits the
+// next time — see fileUploadRequest/Key in file_cache.go for why that's the
+// identity this cache key is built on, not the file's actual bytes.
+func storeUploadedFile(key string, reqBody []byte, respBody []byte) {
+	var uploaded map[string]interface{}
+	if err := json.Unmarshal(respBody, &uploaded); err != nil {
+		return
+	}
+
+	fileId, _ := uploaded["file_id"].(string)
+	if fileId == "" {
+		return
+	}
+
+	request := parseFileUploadRequest(reqBody)
+
+	mime := request.MimeType
+	if mime == "" {
+		mime, _ = uploaded["mime_type"].(string)
+	}
+
+	var bounds [2]int
+	if width, ok := uploaded["width"].(float64); ok {
+		if height, ok := uploaded["height"].(float64); ok {
+			bounds = [2]int{int(width), int(height)}
+		}
+	}
+
+	Files.Store(key, &FileResult{
+		Mime:     mime,
+		Filename: request.FileName,
+		Filesize: request.FileSize,
+		Fileid:   fileId,
+		Isimage:  strings.HasPrefix(mime, "image/"),
+		Bounds:   bounds,
+	})
+}
+
 func ReturnMessage(msg string) gin.H {
 	logger.Warn(msg)
 
@@ -198,8 +329,22 @@ func GetAccessToken(c *gin.Context) string {
 	return accessToken
 }
 
-func GetArkoseToken(api_version int, dx string) (string, error) {
-	return funcaptcha.GetOpenAIToken(api_version, PUID, dx, ProxyUrl)
+// GetArkoseToken solves (or replays) an Arkose token for puid. Callers that
+// acquired an account from Pool must pass that account's own puid rather
+// than the single-account PUID global, since a token solved for one
+// account's puid is rejected by OpenAI for any other account.
+func GetArkoseToken(api_version int, puid string, dx string) (string, error) {
+	proxyUrl := currentProxy()
+	token, err := getArkoseTokenFromProviders(api_version, puid, dx, proxyUrl)
+	if proxyUrl != "" && Rotator != nil {
+		if err != nil {
+			Rotator.MarkFailure(proxyUrl, 0)
+		} else {
+			Rotator.MarkSuccess(proxyUrl)
+		}
+	}
+
+	return token, err
 }
 
 func setupIDs() {
@@ -209,7 +354,23 @@ func setupIDs() {
 	username := os.Getenv("OPENAI_EMAIL")
 	password := os.Getenv("OPENAI_PASSWORD")
 	refreshtoken := os.Getenv("OPENAI_REFRESH_TOKEN")
-	if username != "" && password != "" {
+	if username != "" && password != "" && refreshtoken == "" {
+		// Seed a refresh token via the iOS app's PKCE flow instead of the
+		// Auth0 login-page scraping auth.NewAuthenticator does, so the user
+		// isn't forced to go capture OPENAI_REFRESH_TOKEN by hand.
+		result, err := iosauth.NewPKCEAuthenticator(username, password, ProxyUrl).Authenticate()
+		if err != nil {
+			logger.Warn(fmt.Sprintf("%s: %s", refreshPuidErrorMessage, err))
+		} else {
+			result.PUID = GetPUID(result.AccessToken)
+
+			refreshtoken = result.RefreshToken
+			IMITATE_accessToken = result.AccessToken
+			PUID = result.PUID
+		}
+	}
+
+	if username != "" && password != "" && refreshtoken == "" {
 		go func() {
 			for {
 				authenticator := auth.NewAuthenticator(username, password, ProxyUrl)
@@ -299,13 +460,24 @@ func RefreshAccessToken(refreshToken string) string {
 	req, err := http.NewRequest(http.MethodPost, "https://auth0.openai.com/oauth/token", bytes.NewBuffer(jsonData))
 	req.Header.Set("User-Agent", UserAgent)
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := NewHttpClient().Do(req)
+	client, proxyUrl := NewHttpClient()
+	resp, err := client.Do(req)
 	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to refresh token: %v", err))
+		if proxyUrl != "" && Rotator != nil {
+			Rotator.MarkFailure(proxyUrl, 0)
+		}
 		return ""
 	}
 
 	defer resp.Body.Close()
+	if proxyUrl != "" && Rotator != nil {
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusProxyAuthRequired {
+			Rotator.MarkFailure(proxyUrl, resp.StatusCode)
+		} else {
+			Rotator.MarkSuccess(proxyUrl)
+		}
+	}
 	if resp.StatusCode != http.StatusOK {
 		logger.Error(fmt.Sprintf("Server responded with status code: %d", resp.StatusCode))
 	}
@@ -337,12 +509,23 @@ func GetPUID(accessToken string) string {
 	req.Header.Add("User-Agent", UserAgent)
 	req.Header.Set("Cookie", req.Header.Get("Cookie")+"oai-did="+OAIDID+";")
 
-	resp, err := NewHttpClient().Do(req)
+	client, proxyUrl := NewHttpClient()
+	resp, err := client.Do(req)
 	if err != nil {
 		logger.Error("GetPUID: Missing access token")
+		if proxyUrl != "" && Rotator != nil {
+			Rotator.MarkFailure(proxyUrl, 0)
+		}
 		return ""
 	}
 	defer resp.Body.Close()
+	if proxyUrl != "" && Rotator != nil {
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusProxyAuthRequired {
+			Rotator.MarkFailure(proxyUrl, resp.StatusCode)
+		} else {
+			Rotator.MarkSuccess(proxyUrl)
+		}
+	}
 	if resp.StatusCode != 200 {
 		logger.Error(fmt.Sprintf("GetPUID: Server responded with status code: %d", resp.StatusCode))
 		return ""
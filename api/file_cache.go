@@ -0,0 +1,215 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+const (
+	fileCacheDirName   = "fileCache"
+	fileCacheIndexName = "index.json"
+	fileCacheBlobDir   = "blobs"
+
+	fileCacheMaxAge = time.Hour * 24 * 365
+
+	defaultFileCacheByteBudget = int64(1) << 30 // 1 GiB
+
+	loadFileCacheErrorMessage = "failed to load file cache index"
+	saveFileCacheErrorMessage = "failed to save file cache index"
+)
+
+// FileResult is a previously uploaded file's metadata, keyed by the hash of
+// the account and the declared upload metadata (name/size/mime) that
+// produced it — see fileUploadRequest and Key.
+type FileResult struct {
+	Mime       string    `json:"mime"`
+	Filename   string    `json:"filename"`
+	Filesize   int64     `json:"filesize"`
+	Fileid     string    `json:"fileid"`
+	Isimage    bool      `json:"isimage"`
+	Bounds     [2]int    `json:"bounds,omitempty"`
+	Upload     time.Time `json:"upload"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+func (result *FileResult) expired() bool {
+	return time.Since(result.Upload) > fileCacheMaxAge
+}
+
+// FileCache avoids re-uploading the same image/attachment bytes to
+// /backend-api/files on every request: Proxy can look up a cache key before
+// forwarding a multipart body and substitute the cached file-id instead.
+// Entries older than fileCacheMaxAge are treated as misses so the caller
+// re-uploads and Store overwrites them with a fresh timestamp.
+type FileCache struct {
+	mu          sync.Mutex
+	dir         string
+	byteBudget  int64
+	entries     map[string]*FileResult
+	currentSize int64
+}
+
+// NewFileCache opens (or creates) a file cache rooted at dir, honoring
+// byteBudget as the LRU eviction ceiling for the blob directory.
+func NewFileCache(dir string, byteBudget int64) *FileCache {
+	if byteBudget <= 0 {
+		byteBudget = defaultFileCacheByteBudget
+	}
+
+	cache := &FileCache{
+		dir:        dir,
+		byteBudget: byteBudget,
+		entries:    make(map[string]*FileResult),
+	}
+	cache.load()
+
+	return cache
+}
+
+func (cache *FileCache) indexPath() string {
+	return filepath.Join(cache.dir, fileCacheIndexName)
+}
+
+func (cache *FileCache) blobPath(key string) string {
+	return filepath.Join(cache.dir, fileCacheBlobDir, key)
+}
+
+func (cache *FileCache) load() {
+	data, err := os.ReadFile(cache.indexPath())
+	if err != nil {
+		return
+	}
+
+	var entries map[string]*FileResult
+	if err := json.Unmarshal(data, &entries); err != nil {
+		logger.Warn(loadFileCacheErrorMessage)
+		return
+	}
+
+	for _, entry := range entries {
+		cache.currentSize += entry.Filesize
+		if entry.LastAccess.IsZero() {
+			// Falls back to Upload so index.json files written before
+			// LastAccess was persisted still evict oldest-first instead of
+			// degenerating to map-iteration order.
+			entry.LastAccess = entry.Upload
+		}
+	}
+	cache.entries = entries
+}
+
+func (cache *FileCache) persist() {
+	if err := os.MkdirAll(cache.dir, 0755); err != nil {
+		logger.Error(saveFileCacheErrorMessage)
+		return
+	}
+
+	data, err := json.MarshalIndent(cache.entries, "", "  ")
+	if err != nil {
+		logger.Error(saveFileCacheErrorMessage)
+		return
+	}
+
+	if err := os.WriteFile(cache.indexPath(), data, 0644); err != nil {
+		logger.Error(saveFileCacheErrorMessage)
+	}
+}
+
+// fileUploadRequest is the JSON body ChatGPT's /backend-api/files endpoint
+// receives to request an upload slot. The actual file bytes never pass
+// through this proxy — the client PUTs them straight to the signed blob URL
+// the endpoint returns — so this metadata is the only thing Proxy ever sees
+// to identify an upload by.
+type fileUploadRequest struct {
+	FileName string `json:"file_name"`
+	FileSize int64  `json:"file_size"`
+	MimeType string `json:"mime_type"`
+}
+
+func parseFileUploadRequest(body []byte) fileUploadRequest {
+	var request fileUploadRequest
+	json.Unmarshal(body, &request)
+	return request
+}
+
+// Key derives a cache key from the account and the declared upload metadata
+// (name/size/mime) in body. This is a best-effort identity, not a content
+// hash: since the file bytes themselves never reach this proxy, two uploads
+// that declare identical name/size/mime from the same account collide.
+func Key(account string, body []byte) string {
+	request := parseFileUploadRequest(body)
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s:%s:%d:%s", account, request.FileName, request.FileSize, request.MimeType)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the cached result for key, or nil on a miss or expired
+// entry. A hit refreshes the entry's LRU position.
+func (cache *FileCache) Lookup(account string, key string) *FileResult {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	result, ok := cache.entries[key]
+	if !ok || result.expired() {
+		return nil
+	}
+
+	result.LastAccess = time.Now()
+
+	return result
+}
+
+// Store records a freshly uploaded file under key and evicts the
+// least-recently-used entries until the cache fits within its byte budget.
+func (cache *FileCache) Store(key string, result *FileResult) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	result.Upload = time.Now()
+	result.LastAccess = result.Upload
+
+	if existing, ok := cache.entries[key]; ok {
+		cache.currentSize -= existing.Filesize
+	}
+
+	cache.entries[key] = result
+	cache.currentSize += result.Filesize
+
+	cache.evictLocked()
+	cache.persist()
+}
+
+func (cache *FileCache) evictLocked() {
+	if cache.currentSize <= cache.byteBudget {
+		return
+	}
+
+	keys := make([]string, 0, len(cache.entries))
+	for key := range cache.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return cache.entries[keys[i]].LastAccess.Before(cache.entries[keys[j]].LastAccess)
+	})
+
+	for _, key := range keys {
+		if cache.currentSize <= cache.byteBudget {
+			break
+		}
+
+		entry := cache.entries[key]
+		cache.currentSize -= entry.Filesize
+		delete(cache.entries, key)
+		os.Remove(cache.blobPath(key))
+
+		logger.Info(fmt.Sprintf("evicted file cache entry %s (%d bytes)", key, entry.Filesize))
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyIsDeterministicAndDistinguishesMetadata(t *testing.T) {
+	body := []byte(`{"file_name":"cat.png","file_size":1024,"mime_type":"image/png"}`)
+
+	if Key("a@example.com", body) != Key("a@example.com", body) {
+		t.Fatal("Key is not deterministic for identical input")
+	}
+
+	if Key("a@example.com", body) == Key("b@example.com", body) {
+		t.Fatal("Key collided across different accounts")
+	}
+
+	otherBody := []byte(`{"file_name":"dog.png","file_size":1024,"mime_type":"image/png"}`)
+	if Key("a@example.com", body) == Key("a@example.com", otherBody) {
+		t.Fatal("Key collided across different declared file names")
+	}
+}
+
+func TestFileCacheStoreAndLookup(t *testing.T) {
+	cache := &FileCache{
+		byteBudget: defaultFileCacheByteBudget,
+		entries:    make(map[string]*FileResult),
+		dir:        t.TempDir(),
+	}
+
+	cache.Store("key-a", &FileResult{Fileid: "file-a", Filesize: 100})
+
+	result := cache.Lookup("account", "key-a")
+	if result == nil || result.Fileid != "file-a" {
+		t.Fatalf("Lookup after Store = %+v, want a hit for file-a", result)
+	}
+
+	if cache.Lookup("account", "missing") != nil {
+		t.Fatal("Lookup for an unknown key returned a non-nil result")
+	}
+}
+
+func TestFileCacheLookupMissesExpiredEntry(t *testing.T) {
+	cache := &FileCache{
+		byteBudget: defaultFileCacheByteBudget,
+		entries: map[string]*FileResult{
+			"key-a": {Fileid: "file-a", Upload: time.Now().Add(-fileCacheMaxAge - time.Hour)},
+		},
+	}
+
+	if cache.Lookup("account", "key-a") != nil {
+		t.Fatal("Lookup returned an entry older than fileCacheMaxAge")
+	}
+}
+
+func TestFileCacheEvictLockedEvictsLeastRecentlyUsedFirst(t *testing.T) {
+	now := time.Now()
+	cache := &FileCache{
+		byteBudget: 150,
+		dir:        t.TempDir(),
+		entries: map[string]*FileResult{
+			"oldest": {Filesize: 100, LastAccess: now.Add(-time.Hour)},
+			"newest": {Filesize: 100, LastAccess: now},
+		},
+		currentSize: 200,
+	}
+
+	cache.evictLocked()
+
+	if _, ok := cache.entries["oldest"]; ok {
+		t.Fatal("evictLocked kept the least-recently-used entry")
+	}
+	if _, ok := cache.entries["newest"]; !ok {
+		t.Fatal("evictLocked evicted the most-recently-used entry")
+	}
+	if cache.currentSize > cache.byteBudget {
+		t.Fatalf("currentSize = %d after eviction, want <= byteBudget %d", cache.currentSize, cache.byteBudget)
+	}
+}
+
+func TestFileCacheEvictLockedNoopUnderBudget(t *testing.T) {
+	cache := &FileCache{
+		byteBudget: 1000,
+		entries: map[string]*FileResult{
+			"key-a": {Filesize: 100},
+		},
+		currentSize: 100,
+	}
+
+	cache.evictLocked()
+
+	if _, ok := cache.entries["key-a"]; !ok {
+		t.Fatal("evictLocked removed an entry while under budget")
+	}
+}
+
+func TestFileCacheLoadFallsBackToUploadForMissingLastAccess(t *testing.T) {
+	dir := t.TempDir()
+	cache := &FileCache{dir: dir, entries: make(map[string]*FileResult)}
+	cache.entries["key-a"] = &FileResult{Filesize: 50, Upload: time.Now().Add(-time.Hour)}
+	cache.persist()
+
+	reloaded := &FileCache{dir: dir, entries: make(map[string]*FileResult)}
+	reloaded.load()
+
+	entry, ok := reloaded.entries["key-a"]
+	if !ok {
+		t.Fatal("load did not restore the persisted entry")
+	}
+	if !entry.LastAccess.Equal(entry.Upload) {
+		t.Fatalf("LastAccess = %v after load, want it to fall back to Upload %v", entry.LastAccess, entry.Upload)
+	}
+}
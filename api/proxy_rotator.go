@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+const (
+	proxiesFileName = "proxies.txt"
+
+	maxConsecutiveFailures = 3
+	deadProxyCooldown      = time.Minute * 5
+
+	loadProxiesErrorMessage = "failed to load %s"
+)
+
+type rotatedProxy struct {
+	url                 string
+	consecutiveFailures int
+	deadUntil           time.Time
+}
+
+func (proxy *rotatedProxy) dead() bool {
+	return !proxy.deadUntil.IsZero() && time.Now().Before(proxy.deadUntil)
+}
+
+// ProxyRotator hands out proxies.txt entries one at a time, tracking health
+// so a proxy that starts failing is skipped for a cooldown window instead of
+// taking every request down with it. Reloaded on SIGHUP so the list can be
+// refreshed without a restart.
+type ProxyRotator struct {
+	mu      sync.Mutex
+	proxies []*rotatedProxy
+	next    int
+}
+
+var Rotator *ProxyRotator
+
+// NewProxyRotator loads proxies.txt and starts watching SIGHUP for reloads.
+// It returns nil if proxies.txt doesn't exist, so callers fall back to the
+// single PROXY env var.
+func NewProxyRotator() *ProxyRotator {
+	proxies := loadProxies()
+	if len(proxies) == 0 {
+		return nil
+	}
+
+	rotator := &ProxyRotator{proxies: proxies}
+	go rotator.watchReload()
+
+	return rotator
+}
+
+func loadProxies() []*rotatedProxy {
+	file, err := os.Open(proxiesFileName)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var proxies []*rotatedProxy
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		proxies = append(proxies, &rotatedProxy{url: line})
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.Error(fmt.Sprintf(loadProxiesErrorMessage, proxiesFileName))
+	}
+
+	return proxies
+}
+
+func (rotator *ProxyRotator) watchReload() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	for range sig {
+		proxies := loadProxies()
+		if len(proxies) == 0 {
+			continue
+		}
+
+		rotator.mu.Lock()
+		rotator.proxies = proxies
+		rotator.next = 0
+		rotator.mu.Unlock()
+
+		logger.Info(fmt.Sprintf("reloaded %d proxies from %s", len(proxies), proxiesFileName))
+	}
+}
+
+// Next returns the next healthy proxy URL in the pool, reviving any proxy
+// whose cooldown has elapsed. Returns "" if every proxy is currently dead.
+func (rotator *ProxyRotator) Next() string {
+	rotator.mu.Lock()
+	defer rotator.mu.Unlock()
+
+	for i := 0; i < len(rotator.proxies); i++ {
+		proxy := rotator.proxies[rotator.next%len(rotator.proxies)]
+		rotator.next++
+
+		if proxy.dead() {
+			continue
+		}
+
+		return proxy.url
+	}
+
+	return ""
+}
+
+// MarkFailure records a failed request against proxyUrl, marking it dead for
+// deadProxyCooldown once it's failed maxConsecutiveFailures times in a row,
+// or immediately on a 403/407.
+func (rotator *ProxyRotator) MarkFailure(proxyUrl string, statusCode int) {
+	rotator.mu.Lock()
+	defer rotator.mu.Unlock()
+
+	for _, proxy := range rotator.proxies {
+		if proxy.url != proxyUrl {
+			continue
+		}
+
+		proxy.consecutiveFailures++
+		if statusCode == 403 || statusCode == 407 || proxy.consecutiveFailures >= maxConsecutiveFailures {
+			proxy.deadUntil = time.Now().Add(deadProxyCooldown)
+			logger.Warn(fmt.Sprintf("proxy %s marked dead until %s", proxyUrl, proxy.deadUntil.Format(time.RFC3339)))
+		}
+
+		return
+	}
+}
+
+// MarkSuccess clears the failure streak for proxyUrl after a request using
+// it succeeds.
+func (rotator *ProxyRotator) MarkSuccess(proxyUrl string) {
+	rotator.mu.Lock()
+	defer rotator.mu.Unlock()
+
+	for _, proxy := range rotator.proxies {
+		if proxy.url == proxyUrl {
+			proxy.consecutiveFailures = 0
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProxyRotatorNextRoundRobins(t *testing.T) {
+	rotator := &ProxyRotator{
+		proxies: []*rotatedProxy{
+			{url: "proxy-a"},
+			{url: "proxy-b"},
+		},
+	}
+
+	if got := rotator.Next(); got != "proxy-a" {
+		t.Fatalf("first Next() = %q, want proxy-a", got)
+	}
+	if got := rotator.Next(); got != "proxy-b" {
+		t.Fatalf("second Next() = %q, want proxy-b", got)
+	}
+	if got := rotator.Next(); got != "proxy-a" {
+		t.Fatalf("third Next() = %q, want proxy-a", got)
+	}
+}
+
+func TestProxyRotatorNextSkipsDeadProxies(t *testing.T) {
+	rotator := &ProxyRotator{
+		proxies: []*rotatedProxy{
+			{url: "proxy-a", deadUntil: time.Now().Add(time.Minute)},
+			{url: "proxy-b"},
+		},
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := rotator.Next(); got != "proxy-b" {
+			t.Fatalf("Next() = %q, want proxy-b (proxy-a is dead)", got)
+		}
+	}
+}
+
+func TestProxyRotatorNextReturnsEmptyWhenAllDead(t *testing.T) {
+	rotator := &ProxyRotator{
+		proxies: []*rotatedProxy{
+			{url: "proxy-a", deadUntil: time.Now().Add(time.Minute)},
+		},
+	}
+
+	if got := rotator.Next(); got != "" {
+		t.Fatalf("Next() = %q, want empty string when every proxy is dead", got)
+	}
+}
+
+func TestProxyRotatorMarkFailureDeadensAfterThreshold(t *testing.T) {
+	rotator := &ProxyRotator{
+		proxies: []*rotatedProxy{{url: "proxy-a"}},
+	}
+
+	for i := 0; i < maxConsecutiveFailures-1; i++ {
+		rotator.MarkFailure("proxy-a", 0)
+		if rotator.proxies[0].dead() {
+			t.Fatalf("proxy marked dead after only %d failures, want %d", i+1, maxConsecutiveFailures)
+		}
+	}
+
+	rotator.MarkFailure("proxy-a", 0)
+	if !rotator.proxies[0].dead() {
+		t.Fatalf("proxy not marked dead after %d consecutive failures", maxConsecutiveFailures)
+	}
+}
+
+func TestProxyRotatorMarkFailureDeadensImmediatelyOn403(t *testing.T) {
+	rotator := &ProxyRotator{
+		proxies: []*rotatedProxy{{url: "proxy-a"}},
+	}
+
+	rotator.MarkFailure("proxy-a", 403)
+
+	if !rotator.proxies[0].dead() {
+		t.Fatal("proxy not marked dead immediately on a 403")
+	}
+}
+
+func TestProxyRotatorMarkSuccessClearsFailureStreak(t *testing.T) {
+	rotator := &ProxyRotator{
+		proxies: []*rotatedProxy{{url: "proxy-a", consecutiveFailures: maxConsecutiveFailures - 1}},
+	}
+
+	rotator.MarkSuccess("proxy-a")
+
+	if rotator.proxies[0].consecutiveFailures != 0 {
+		t.Fatalf("consecutiveFailures = %d after MarkSuccess, want 0", rotator.proxies[0].consecutiveFailures)
+	}
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xqdoo00o/OpenAIAuth/auth"
+
+	"github.com/linweiyuan/go-logger/logger"
+)
+
+const (
+	accountsFileName     = "accounts.txt"
+	harPoolDirName       = "harPool"
+	accessTokensFileName = "access_tokens.json"
+
+	accountExpiry = time.Hour * 24 * 7
+
+	loadAccountsErrorMessage = "failed to load %s"
+	authenticateErrorMessage = "failed to authenticate account %s: %s"
+)
+
+// tokenAccount is a single pooled credential along with the access token
+// and PUID we most recently obtained for it.
+type tokenAccount struct {
+	Email       string    `json:"email"`
+	Password    string    `json:"-"`
+	AccessToken string    `json:"access_token"`
+	Puid        string    `json:"puid"`
+	HarFile     string    `json:"har_file,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Deactivated bool      `json:"deactivated"`
+}
+
+func (account *tokenAccount) expired() bool {
+	return time.Now().After(account.ExpiresAt)
+}
+
+// TokenPool round-robins access tokens across a pool of ChatGPT accounts,
+// populated from accountsFileName (one "email:password" per line) and
+// harPoolDirName (HAR captures matched to accounts by file name), and keeps
+// accessTokensFileName up to date so re-authentication isn't needed across
+// restarts.
+type TokenPool struct {
+	mu       sync.Mutex
+	accounts []*tokenAccount
+	next     int
+}
+
+// NewTokenPool loads accounts.txt and harPool/, restores any cached access
+// tokens from access_tokens.json and starts the background re-auth loop. It
+// returns nil if no accounts are configured so callers can fall back to the
+// single-account globals.
+func NewTokenPool() *TokenPool {
+	accounts := loadAccounts()
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	pool := &TokenPool{accounts: accounts}
+	pool.restoreTokens()
+
+	go pool.refreshLoop()
+
+	return pool
+}
+
+func loadAccounts() []*tokenAccount {
+	file, err := os.Open(accountsFileName)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var accounts []*tokenAccount
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			logger.Warn(fmt.Sprintf("skipping malformed line in %s: %s", accountsFileName, line))
+			continue
+		}
+
+		accounts = append(accounts, &tokenAccount{
+			Email:    parts[0],
+			Password: parts[1],
+			HarFile:  harFileForAccount(parts[0]),
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.Error(fmt.Sprintf(loadAccountsErrorMessage, accountsFileName))
+	}
+
+	return accounts
+}
+
+// harFileForAccount returns the HAR capture matching email, if harPool/
+// contains one named after the account (e.g. harPool/user@example.com.har).
+func harFileForAccount(email string) string {
+	path := filepath.Join(harPoolDirName, email+".har")
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+
+	return ""
+}
+
+func (pool *TokenPool) restoreTokens() {
+	data, err := os.ReadFile(accessTokensFileName)
+	if err != nil {
+		return
+	}
+
+	var cached []*tokenAccount
+	if err := json.Unmarshal(data, &cached); err != nil {
+		logger.Warn(fmt.Sprintf("failed to parse %s", accessTokensFileName))
+		return
+	}
+
+	byEmail := make(map[string]*tokenAccount, len(cached))
+	for _, entry := range cached {
+		byEmail[entry.Email] = entry
+	}
+
+	for _, account := range pool.accounts {
+		if entry, ok := byEmail[account.Email]; ok {
+			account.AccessToken = entry.AccessToken
+			account.Puid = entry.Puid
+			account.ExpiresAt = entry.ExpiresAt
+			account.Deactivated = entry.Deactivated
+		}
+	}
+}
+
+func (pool *TokenPool) persistTokens() {
+	data, err := json.MarshalIndent(pool.accounts, "", "  ")
+	if err != nil {
+		logger.Error("failed to marshal access token pool")
+		return
+	}
+
+	if err := os.WriteFile(accessTokensFileName, data, 0600); err != nil {
+		logger.Error(fmt.Sprintf("failed to write %s", accessTokensFileName))
+	}
+}
+
+// Acquire returns the access token, PUID and device id for the next account
+// in the pool, skipping deactivated accounts. It round-robins across the
+// remaining accounts so load is spread evenly.
+func (pool *TokenPool) Acquire(c *gin.Context) (accessToken string, puid string, oaidid string) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for i := 0; i < len(pool.accounts); i++ {
+		account := pool.accounts[pool.next%len(pool.accounts)]
+		pool.next++
+
+		if account.Deactivated || account.AccessToken == "" {
+			continue
+		}
+
+		return account.AccessToken, account.Puid, OAIDID
+	}
+
+	return "", "", OAIDID
+}
+
+// HarFileForPUID returns the HAR capture path for the account that most
+// recently authenticated with puid, so the Arkose provider (chunk0-5) can
+// replay tokens recorded for that same account instead of a random one.
+func (pool *TokenPool) HarFileForPUID(puid string) string {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for _, account := range pool.accounts {
+		if account.Puid == puid {
+			return account.HarFile
+		}
+	}
+
+	return ""
+}
+
+// Deactivate marks the account that issued accessToken as unusable so
+// Acquire stops handing it out until it's re-authenticated.
+func (pool *TokenPool) Deactivate(accessToken string) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for _, account := range pool.accounts {
+		if account.AccessToken == accessToken {
+			account.Deactivated = true
+			logger.Warn(fmt.Sprintf(AccountDeactivatedErrorMessage, account.Email))
+			return
+		}
+	}
+}
+
+func (pool *TokenPool) refreshLoop() {
+	for {
+		pool.mu.Lock()
+		accounts := make([]*tokenAccount, len(pool.accounts))
+		copy(accounts, pool.accounts)
+		pool.mu.Unlock()
+
+		for _, account := range accounts {
+			if account.AccessToken != "" && !account.expired() {
+				continue
+			}
+
+			pool.authenticate(account)
+		}
+
+		pool.persistTokens()
+
+		time.Sleep(time.Hour)
+	}
+}
+
+func (pool *TokenPool) authenticate(account *tokenAccount) {
+	authenticator := auth.NewAuthenticator(account.Email, account.Password, ProxyUrl)
+	if err := authenticator.Begin(); err != nil {
+		logger.Warn(fmt.Sprintf(authenticateErrorMessage, account.Email, err.Details))
+		return
+	}
+
+	accessToken := authenticator.GetAccessToken()
+	if accessToken == "" {
+		logger.Warn(fmt.Sprintf(authenticateErrorMessage, account.Email, "empty access token"))
+		return
+	}
+
+	pool.mu.Lock()
+	account.AccessToken = accessToken
+	account.Puid = GetPUID(accessToken)
+	account.ExpiresAt = time.Now().Add(accountExpiry)
+	account.Deactivated = false
+	pool.mu.Unlock()
+
+	logger.Info(fmt.Sprintf("access token refreshed for %s", account.Email))
+}
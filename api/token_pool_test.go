@@ -0,0 +1,95 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTokenPoolAcquireRoundRobinsAndSkipsDeactivated(t *testing.T) {
+	pool := &TokenPool{
+		accounts: []*tokenAccount{
+			{Email: "a@example.com", AccessToken: "token-a", Puid: "puid-a"},
+			{Email: "b@example.com", AccessToken: "token-b", Puid: "puid-b", Deactivated: true},
+			{Email: "c@example.com", AccessToken: "token-c", Puid: "puid-c"},
+		},
+	}
+
+	c := &gin.Context{}
+
+	accessToken, puid, _ := pool.Acquire(c)
+	if accessToken != "token-a" || puid != "puid-a" {
+		t.Fatalf("first Acquire = (%q, %q), want (token-a, puid-a)", accessToken, puid)
+	}
+
+	// b is deactivated, so the next call must skip straight to c.
+	accessToken, puid, _ = pool.Acquire(c)
+	if accessToken != "token-c" || puid != "puid-c" {
+		t.Fatalf("second Acquire = (%q, %q), want (token-c, puid-c)", accessToken, puid)
+	}
+
+	// Wraps back around to a.
+	accessToken, puid, _ = pool.Acquire(c)
+	if accessToken != "token-a" || puid != "puid-a" {
+		t.Fatalf("third Acquire = (%q, %q), want (token-a, puid-a)", accessToken, puid)
+	}
+}
+
+func TestTokenPoolAcquireSkipsAccountsWithoutAccessToken(t *testing.T) {
+	pool := &TokenPool{
+		accounts: []*tokenAccount{
+			{Email: "pending@example.com"},
+		},
+	}
+
+	accessToken, puid, _ := pool.Acquire(&gin.Context{})
+	if accessToken != "" || puid != "" {
+		t.Fatalf("Acquire = (%q, %q), want empty strings when no account has an access token", accessToken, puid)
+	}
+}
+
+func TestTokenPoolHarFileForPUID(t *testing.T) {
+	pool := &TokenPool{
+		accounts: []*tokenAccount{
+			{Email: "a@example.com", Puid: "puid-a", HarFile: "harPool/a@example.com.har"},
+			{Email: "b@example.com", Puid: "puid-b"},
+		},
+	}
+
+	if got := pool.HarFileForPUID("puid-a"); got != "harPool/a@example.com.har" {
+		t.Fatalf("HarFileForPUID(puid-a) = %q, want harPool/a@example.com.har", got)
+	}
+	if got := pool.HarFileForPUID("puid-b"); got != "" {
+		t.Fatalf("HarFileForPUID(puid-b) = %q, want empty", got)
+	}
+	if got := pool.HarFileForPUID("unknown"); got != "" {
+		t.Fatalf("HarFileForPUID(unknown) = %q, want empty", got)
+	}
+}
+
+func TestTokenPoolDeactivate(t *testing.T) {
+	pool := &TokenPool{
+		accounts: []*tokenAccount{
+			{Email: "a@example.com", AccessToken: "token-a"},
+		},
+	}
+
+	pool.Deactivate("token-a")
+
+	if !pool.accounts[0].Deactivated {
+		t.Fatal("Deactivate did not mark the matching account deactivated")
+	}
+}
+
+func TestTokenAccountExpired(t *testing.T) {
+	account := &tokenAccount{ExpiresAt: time.Now().Add(-time.Minute)}
+	if !account.expired() {
+		t.Fatal("expired() = false for an ExpiresAt in the past")
+	}
+
+	account.ExpiresAt = time.Now().Add(time.Minute)
+	if account.expired() {
+		t.Fatal("expired() = true for an ExpiresAt in the future")
+	}
+}
@@ -0,0 +1,242 @@
+// Package auth implements the iOS app's OAuth flow (Auth0 + PKCE) as an
+// alternative to scraping the web login pages via xqdoo00o/OpenAIAuth. It
+// exchanges an email/password for both an access token and a refresh token
+// in one pass, so callers don't need the user to supply OPENAI_REFRESH_TOKEN
+// up front.
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/profiles"
+)
+
+const (
+	clientId    = "pdlLIX2Y72MIl2rhLhTE9VV9bN905kBh"
+	redirectUri = "com.openai.chat://auth0.openai.com/ios/com.openai.chat/callback"
+	authScope   = "openid email profile offline_access model.request model.read organization.read organization.write"
+	audience    = "https://api.openai.com/v1"
+
+	auth0Url         = "https://auth0.openai.com"
+	authorizeUrl     = auth0Url + "/authorize"
+	loginUsernameUrl = auth0Url + "/u/login/identifier?state="
+	loginPasswordUrl = auth0Url + "/u/login/password?state="
+	tokenUrl         = auth0Url + "/oauth/token"
+
+	getAuthorizedUrlErrorMessage = "failed to get authorized url"
+	checkUsernameErrorMessage    = "email is not valid"
+	checkPasswordErrorMessage    = "email or password is not correct"
+	missingCodeErrorMessage      = "failed to get authorization code from redirect"
+	exchangeTokenErrorMessage    = "failed to exchange authorization code"
+)
+
+// AuthResult holds everything RefreshAccessToken needs to keep a session
+// alive without the user ever handling a refresh token themselves.
+type AuthResult struct {
+	AccessToken  string
+	RefreshToken string
+	PUID         string
+}
+
+// PKCEAuthenticator drives the same OAuth flow the official iOS app uses:
+// an authorization code request with a PKCE challenge, login via the
+// identifier/password endpoints, then a code exchange for tokens.
+type PKCEAuthenticator struct {
+	email    string
+	password string
+	client   tls_client.HttpClient
+
+	state        string
+	codeVerifier string
+}
+
+// NewPKCEAuthenticator builds an authenticator bound to a non-redirect-
+// following client using the Safari_IOS_16_0 profile, matching what the
+// real iOS app presents.
+func NewPKCEAuthenticator(email string, password string, proxy string) *PKCEAuthenticator {
+	client, _ := tls_client.NewHttpClient(tls_client.NewNoopLogger(), []tls_client.HttpClientOption{
+		tls_client.WithCookieJar(tls_client.NewCookieJar()),
+		tls_client.WithClientProfile(profiles.Safari_IOS_16_0),
+		tls_client.WithNotFollowRedirects(),
+	}...)
+	if proxy != "" {
+		client.SetProxy(proxy)
+	}
+
+	return &PKCEAuthenticator{
+		email:    email,
+		password: password,
+		client:   client,
+	}
+}
+
+// Authenticate runs the full PKCE login flow and returns the resulting
+// access and refresh tokens.
+func (authenticator *PKCEAuthenticator) Authenticate() (*AuthResult, error) {
+	codeChallenge, err := authenticator.generatePKCE()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authenticator.getAuthorizedUrl(codeChallenge); err != nil {
+		return nil, err
+	}
+
+	if err := authenticator.checkUsername(); err != nil {
+		return nil, err
+	}
+
+	code, err := authenticator.checkPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	return authenticator.exchangeToken(code)
+}
+
+// generatePKCE creates the verifier/challenge pair and the CSRF state,
+// following RFC 7636 (S256 challenge method).
+func (authenticator *PKCEAuthenticator) generatePKCE() (string, error) {
+	stateBytes := make([]byte, 32)
+	if _, err := rand.Read(stateBytes); err != nil {
+		return "", err
+	}
+	authenticator.state = base64.RawURLEncoding.EncodeToString(stateBytes)
+
+	verifierBytes := make([]byte, 32)
+	if _, err := rand.Read(verifierBytes); err != nil {
+		return "", err
+	}
+	authenticator.codeVerifier = base64.RawURLEncoding.EncodeToString(verifierBytes)
+
+	sum := sha256.Sum256([]byte(authenticator.codeVerifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func (authenticator *PKCEAuthenticator) getAuthorizedUrl(codeChallenge string) error {
+	query := url.Values{}
+	query.Set("client_id", clientId)
+	query.Set("response_type", "code")
+	query.Set("redirect_uri", redirectUri)
+	query.Set("scope", authScope)
+	query.Set("audience", audience)
+	query.Set("prompt", "login")
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	query.Set("state", authenticator.state)
+
+	req, _ := http.NewRequest(http.MethodGet, authorizeUrl+"?"+query.Encode(), nil)
+	resp, err := authenticator.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", getAuthorizedUrlErrorMessage, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return fmt.Errorf(getAuthorizedUrlErrorMessage)
+	}
+
+	return nil
+}
+
+func (authenticator *PKCEAuthenticator) checkUsername() error {
+	form := url.Values{}
+	form.Set("state", authenticator.state)
+	form.Set("username", authenticator.email)
+	form.Set("js-available", "true")
+	form.Set("action", "default")
+
+	req, _ := http.NewRequest(http.MethodPost, loginUsernameUrl+authenticator.state, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := authenticator.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", checkUsernameErrorMessage, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return fmt.Errorf(checkUsernameErrorMessage)
+	}
+
+	return nil
+}
+
+func (authenticator *PKCEAuthenticator) checkPassword() (string, error) {
+	form := url.Values{}
+	form.Set("state", authenticator.state)
+	form.Set("username", authenticator.email)
+	form.Set("password", authenticator.password)
+	form.Set("action", "default")
+
+	req, _ := http.NewRequest(http.MethodPost, loginPasswordUrl+authenticator.state, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := authenticator.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", checkPasswordErrorMessage, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return "", fmt.Errorf(checkPasswordErrorMessage)
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", missingCodeErrorMessage, err)
+	}
+
+	code := location.Query().Get("code")
+	if code == "" {
+		return "", fmt.Errorf(missingCodeErrorMessage)
+	}
+
+	return code, nil
+}
+
+func (authenticator *PKCEAuthenticator) exchangeToken(code string) (*AuthResult, error) {
+	data := map[string]interface{}{
+		"redirect_uri":  redirectUri,
+		"grant_type":    "authorization_code",
+		"client_id":     clientId,
+		"code":          code,
+		"code_verifier": authenticator.codeVerifier,
+	}
+	jsonData, _ := json.Marshal(data)
+
+	req, _ := http.NewRequest(http.MethodPost, tokenUrl, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := authenticator.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", exchangeTokenErrorMessage, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", exchangeTokenErrorMessage, err)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("%s: %w", exchangeTokenErrorMessage, err)
+	}
+
+	accessToken, _ := result["access_token"].(string)
+	refreshToken, _ := result["refresh_token"].(string)
+	if accessToken == "" || refreshToken == "" {
+		return nil, fmt.Errorf("%s: %v", exchangeTokenErrorMessage, result)
+	}
+
+	return &AuthResult{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+)
+
+func TestGeneratePKCEProducesURLSafeChallengeOfVerifier(t *testing.T) {
+	authenticator := &PKCEAuthenticator{}
+
+	codeChallenge, err := authenticator.generatePKCE()
+	if err != nil {
+		t.Fatalf("generatePKCE returned an error: %v", err)
+	}
+
+	if authenticator.state == "" {
+		t.Fatal("generatePKCE did not set state")
+	}
+	if authenticator.codeVerifier == "" {
+		t.Fatal("generatePKCE did not set codeVerifier")
+	}
+
+	sum := sha256.Sum256([]byte(authenticator.codeVerifier))
+	want := base64.RawURLEncoding.EncodeToString(sum[:])
+	if codeChallenge != want {
+		t.Fatalf("codeChallenge = %q, want S256(codeVerifier) = %q", codeChallenge, want)
+	}
+}
+
+func TestGeneratePKCEIsRandomPerCall(t *testing.T) {
+	first := &PKCEAuthenticator{}
+	second := &PKCEAuthenticator{}
+
+	if _, err := first.generatePKCE(); err != nil {
+		t.Fatalf("first generatePKCE returned an error: %v", err)
+	}
+	if _, err := second.generatePKCE(); err != nil {
+		t.Fatalf("second generatePKCE returned an error: %v", err)
+	}
+
+	if first.state == second.state {
+		t.Fatal("two calls to generatePKCE produced the same state")
+	}
+	if first.codeVerifier == second.codeVerifier {
+		t.Fatal("two calls to generatePKCE produced the same codeVerifier")
+	}
+}